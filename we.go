@@ -22,10 +22,43 @@
 // if given a wrapped_error these functions will actually just mutate
 // the wrapped_error and return it.
 //
+// wrapped_error implements Unwrap/Is/As, so it plays along with the
+// standard errors package (errors.Is, errors.As, errors.Unwrap).  Wrap and
+// Wrapf are provided alongside New/Newf for code migrating from
+// fmt.Errorf("...: %w", e), pkg/errors or friendsofgo/errors, where each
+// call is expected to nest rather than mutate.
+//
+// wrapped_error also captures a stack on first wrap (see CaptureStacks) and
+// implements fmt.Formatter: `%+v` prints we.Details(e), the full chain of
+// causes with file:line:function frames, while `%s`/`%v`/`%q` print the
+// normal Error() message.
+//
+// Arbitrary key/value metadata (request IDs, HTTP status codes, ...) can be
+// attached with WithValue and read back with Value/Values, without having
+// to invent a new error type for it:
+//
+//	err = we.WithValue(err, "status", 404)
+//	we.Value(err, "status") == 404
+//
+// Handle/HandleWith/Must turn the exit code tracking into a single final
+// call at the end of main(): `we.Handle(err)` reports err and os.Exit()s
+// with ExitCode(err).
+//
+// Raise/Catch offer an optional panic-based exception style (following the
+// "exc" package) for callers who'd rather not check an error after every
+// call: `we.Raise(err)` panics, and `defer we.Catch(&err)` at the top of the
+// function turns it back into a normal returned error.
+//
+// we.Append/we.Combine build a *Multi out of several independent failures
+// (as from a set of worker goroutines), joining their messages one per line
+// and reconciling ExitCode() to the max non-default code among them.
 package we
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"runtime"
 	"strings"
 )
@@ -36,11 +69,30 @@ var MainPrefix bool = false
 // DefaultExitCode: exit code when WithExitCode() not used.
 var DefaultExitCode int = 1
 
+// CaptureStacks: set to false to skip the runtime.Callers() stack capture
+// New/Newf/NewEC/NewfEC/WithExitCode/Wrap/Wrapf otherwise do on first wrap,
+// for users who can't afford the overhead in hot paths.
+var CaptureStacks bool = true
+
+// MaxStackDepth: how many frames of stack CaptureStacks captures, like merry.
+var MaxStackDepth int = 32
+
 // wrapped_error is the error type of "we".
 type wrapped_error struct {
-	msg   string
-	cause error
-	code  int
+	msg     string
+	cause   error
+	code    int
+	stack   []uintptr
+	values  *kv
+	userMsg string
+}
+
+// kv is one node of the values linked list, newest first.  A linked list
+// keeps the common case of a wrapped_error carrying no values allocation-free.
+type kv struct {
+	key   interface{}
+	value interface{}
+	next  *kv
 }
 
 // wrapped_error implements the error interface.
@@ -56,13 +108,131 @@ func Cause(e error) error {
 	return e
 }
 
-// new_newf is the implementation of New and Newf.
-func new_newf(f bool, e error, args ...interface{}) error {
+// Unwrap returns self.cause, so that the standard library's errors.Unwrap,
+// errors.Is and errors.As can traverse into a *wrapped_error chain.
+//
+// Note New/Newf/NewEC/NewfEC/WithExitCode/Prependf mutate an already
+// wrapped_error in place instead of nesting a new one around it (see
+// new_newf below), so self.cause always stays the original, non-we error
+// that started the chain: Unwrap() keeps returning that same leaf cause no
+// matter how many times the value was re-wrapped.
+func (self *wrapped_error) Unwrap() error {
+	return self.cause
+}
+
+// Is reports whether self.cause (or anything it wraps) matches target, by
+// delegating to errors.Is. This is deliberately redundant with Unwrap()
+// alone already letting errors.Is walk the chain -- it's here so self.Is
+// reads as a first-class, intentional part of the type for anyone grepping
+// the method set, not something quietly inherited by accident.
+func (self *wrapped_error) Is(target error) bool {
+	return errors.Is(self.cause, target)
+}
+
+// As finds the first error in self.cause's chain matching target, by
+// delegating to errors.As. Deliberately redundant with Unwrap() for the
+// same reason as Is above.
+func (self *wrapped_error) As(target interface{}) bool {
+	return errors.As(self.cause, target)
+}
+
+// StackTrace returns the stack captured when self was first created, or nil
+// if CaptureStacks was false at the time (or self predates this field).
+func (self *wrapped_error) StackTrace() []runtime.Frame {
+	if len(self.stack) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(self.stack)
+	res := make([]runtime.Frame, 0, len(self.stack))
+	for {
+		frame, more := frames.Next()
+		res = append(res, frame)
+		if !more {
+			break
+		}
+	}
+	return res
+}
+
+// Format implements fmt.Formatter: %s and %v print the current message,
+// %q quotes it, and %+v walks the cause chain printing each captured stack,
+// in the style of pkg/errors and merry.
+func (self *wrapped_error) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if f.Flag('+') {
+			io.WriteString(f, Details(self))
+			return
+		}
+		io.WriteString(f, self.msg)
+	case 's':
+		io.WriteString(f, self.msg)
+	case 'q':
+		fmt.Fprintf(f, "%q", self.msg)
+	}
+}
+
+// captureStack records the current stack, "skip" frames above
+// runtime.Callers as per caller(), or nil if CaptureStacks is false.
+func captureStack(skip int) []uintptr {
+	if !CaptureStacks {
+		return nil
+	}
+	pc := make([]uintptr, MaxStackDepth)
+	n := runtime.Callers(skip, pc)
+	return pc[:n]
+}
+
+// Details returns the message of err together with, for every
+// *wrapped_error in its cause chain that captured one, the full
+// file:line:function stack at the point it was created -- the %+v view.
+func Details(err error) string {
+	if err == nil {
+		return ""
+	}
+	if m, ok := err.(*Multi); ok {
+		parts := make([]string, len(m.errs))
+		for i, e := range m.errs {
+			parts[i] = Details(e)
+		}
+		return strings.Join(parts, "\n")
+	}
+	var b strings.Builder
+	b.WriteString(err.Error())
+	for err != nil {
+		if m, ok := err.(*Multi); ok {
+			parts := make([]string, len(m.errs))
+			for i, e := range m.errs {
+				parts[i] = Details(e)
+			}
+			b.WriteString("\n")
+			b.WriteString(strings.Join(parts, "\n"))
+			break
+		}
+		we, ok := err.(*wrapped_error)
+		if !ok {
+			break
+		}
+		if len(we.stack) > 0 {
+			b.WriteString("\n")
+			for _, frame := range we.StackTrace() {
+				fmt.Fprintf(&b, "\t%s\n\t\t%s:%d\n", frame.Function, frame.File, frame.Line)
+			}
+		}
+		err = we.cause
+	}
+	return b.String()
+}
+
+// new_newf is the implementation of New and Newf, parameterized by skip so
+// callers one stack frame further from the user (like Must) can still land
+// on the real call site instead of attributing to themselves.
+func new_newf(f bool, skip int, e error, args ...interface{}) error {
 	if e == nil {
 		return nil
 	}
 
-	funcname := caller(4) // skip 4: New[f][EC](), new_newf(), caller() and runtime.Callers()
+	funcname := caller(skip)
 	if !MainPrefix && strings.HasPrefix(funcname, "main.") {
 		funcname = funcname[5:]
 	}
@@ -87,35 +257,49 @@ func new_newf(f bool, e error, args ...interface{}) error {
 	res.msg = msg
 	res.cause = e
 	res.code = DefaultExitCode
+	res.stack = captureStack(skip) // skip: same frames as caller(skip) above
 	return res
 }
 
 // New create a new wrapped_error with the given arguments.
 func New(e error, args ...interface{}) error {
-	return new_newf(false, e, args...)
+	return new_newf(false, 4, e, args...) // skip 4: New(), new_newf(), caller() and runtime.Callers()
 }
 
 // Newf create a new wrapped_error with the given format and arguments.
 func Newf(e error, format_and_args ...interface{}) error {
-	return new_newf(true, e, format_and_args...)
+	return new_newf(true, 4, e, format_and_args...) // skip 4: Newf(), new_newf(), caller() and runtime.Callers()
 }
 
 // NewEC == New + WithExitCode
 func NewEC(code int, e error, args ...interface{}) error {
-	res := new_newf(false, e, args...)
+	res := new_newf(false, 4, e, args...) // skip 4: NewEC(), new_newf(), caller() and runtime.Callers()
 	return WithExitCode(code, res)
 }
 
 // NewfEC == Newf + WithExitCode
 func NewfEC(code int, e error, format_and_args ...interface{}) error {
-	res := new_newf(true, e, format_and_args...)
+	res := new_newf(true, 4, e, format_and_args...) // skip 4: NewfEC(), new_newf(), caller() and runtime.Callers()
 	return WithExitCode(code, res)
 }
 
-// ExitCode extracts the exit code if e is a wrapped_error, otherwise returns DefaultExitCode.
+// ExitCode extracts the exit code set anywhere in e's cause chain (the
+// nearest non-default one wins), walking down via errors.Unwrap the same
+// way Value/UserMessage do -- Wrap/Wrapf always nest a fresh wrapped_error
+// with DefaultExitCode, so without this walk a code set with WithExitCode
+// further down the chain would be lost the moment it's wrapped again.
+// Returns DefaultExitCode if e is nil or no code was ever set.
 func ExitCode(e error) int {
-	if e, ok := e.(*wrapped_error); ok {
-		return e.code
+	for e != nil {
+		switch t := e.(type) {
+		case *wrapped_error:
+			if t.code != DefaultExitCode {
+				return t.code
+			}
+		case *Multi:
+			return t.ExitCode()
+		}
+		e = errors.Unwrap(e)
 	}
 	return DefaultExitCode
 }
@@ -133,9 +317,132 @@ func WithExitCode(code int, e error) error {
 	res.msg = e.Error()
 	res.cause = e
 	res.code = code
+	res.stack = captureStack(3) // skip 3: WithExitCode(), captureStack() and runtime.Callers()
+	return res
+}
+
+// WithValue attaches key/value metadata to e, mutating it in place if it is
+// already a wrapped_error (same convention as WithExitCode), or wrapping it
+// in a new one otherwise.
+func WithValue(e error, key, value interface{}) error {
+	if e == nil {
+		return nil
+	}
+	if e, ok := e.(*wrapped_error); ok {
+		e.values = &kv{key: key, value: value, next: e.values}
+		return e
+	}
+	res := new(wrapped_error)
+	res.msg = e.Error()
+	res.cause = e
+	res.code = DefaultExitCode
+	res.stack = captureStack(3) // skip 3: WithValue(), captureStack() and runtime.Callers()
+	res.values = &kv{key: key, value: value}
 	return res
 }
 
+// Value looks up key in e, walking down its cause chain (following
+// errors.Unwrap so it also sees through non-we wrapping) until a
+// wrapped_error carrying that key is found. A *Multi is searched by trying
+// each child in turn. It returns nil if none is found.
+func Value(e error, key interface{}) interface{} {
+	for e != nil {
+		if m, ok := e.(*Multi); ok {
+			for _, child := range m.errs {
+				if v := Value(child, key); v != nil {
+					return v
+				}
+			}
+			return nil
+		}
+		if e, ok := e.(*wrapped_error); ok {
+			for n := e.values; n != nil; n = n.next {
+				if n.key == key {
+					return n.value
+				}
+			}
+		}
+		e = errors.Unwrap(e)
+	}
+	return nil
+}
+
+// Values returns the merged view of every key/value pair attached anywhere
+// in e's cause chain; a key set closer to e wins over one set further down.
+// A *Multi merges its children's values in order, first child wins ties.
+func Values(e error) map[interface{}]interface{} {
+	res := make(map[interface{}]interface{})
+	for e != nil {
+		if m, ok := e.(*Multi); ok {
+			for _, child := range m.errs {
+				for k, v := range Values(child) {
+					if _, exists := res[k]; !exists {
+						res[k] = v
+					}
+				}
+			}
+			return res
+		}
+		if e, ok := e.(*wrapped_error); ok {
+			for n := e.values; n != nil; n = n.next {
+				if _, exists := res[n.key]; !exists {
+					res[n.key] = n.value
+				}
+			}
+		}
+		e = errors.Unwrap(e)
+	}
+	return res
+}
+
+// WithUserMessage attaches a user-facing message to e, separate from the
+// developer-facing Error() string, mutating e in place if it is already a
+// wrapped_error (same convention as WithExitCode/WithValue).
+func WithUserMessage(e error, msg string) error {
+	if e == nil {
+		return nil
+	}
+	if e, ok := e.(*wrapped_error); ok {
+		e.userMsg = msg
+		return e
+	}
+	res := new(wrapped_error)
+	res.msg = e.Error()
+	res.cause = e
+	res.code = DefaultExitCode
+	res.stack = captureStack(3) // skip 3: WithUserMessage(), captureStack() and runtime.Callers()
+	res.userMsg = msg
+	return res
+}
+
+// WithUserMessagef is like WithUserMessage but with fmt formatting.
+func WithUserMessagef(e error, format string, args ...interface{}) error {
+	return WithUserMessage(e, fmt.Sprintf(format, args...))
+}
+
+// UserMessage returns the user-facing message attached anywhere in e's
+// cause chain (the nearest one to e wins), or "" if none was set. This is
+// meant for CLI/HTTP servers that want to log the full developer-facing
+// chain (see Details) while presenting a clean sentence to end users. A
+// *Multi is searched by trying each child in turn.
+func UserMessage(e error) string {
+	for e != nil {
+		if m, ok := e.(*Multi); ok {
+			for _, child := range m.errs {
+				if msg := UserMessage(child); msg != "" {
+					return msg
+				}
+			}
+			return ""
+		}
+		if e, ok := e.(*wrapped_error); ok && e.userMsg != "" {
+			return e.userMsg
+		}
+		e = errors.Unwrap(e)
+	}
+	return ""
+}
+
 // callers returns the name of the function "skip" frames above runtime.Callers.
 func caller(skip int) string {
 	var pc [1]uintptr
@@ -160,6 +467,7 @@ func Prependf(e error, format string, args ...interface{}) error {
 	res.msg = msg
 	res.cause = e
 	res.code = DefaultExitCode
+	res.stack = captureStack(3) // skip 3: Prependf(), captureStack() and runtime.Callers()
 	return res
 }
 
@@ -167,3 +475,203 @@ func Prependf(e error, format string, args ...interface{}) error {
 func Errorf(format string, a ...interface{}) error {
 	return fmt.Errorf(format, a...)
 }
+
+// Handle is the idiomatic end of main(): it reports err (nil is a no-op)
+// and exits with ExitCode(err), turning the WithExitCode/NewEC/NewfEC
+// tracking into a single final call instead of a DIY os.Exit(we.ExitCode(err)).
+func Handle(err error) {
+	HandleWith(os.Stderr, os.Exit, err)
+}
+
+// HandleWith is Handle with the output writer and exit function injected,
+// for testing call sites that can't actually afford to exit the process.
+func HandleWith(w io.Writer, exit func(int), err error) {
+	if err == nil {
+		return
+	}
+	if CaptureStacks {
+		fmt.Fprintln(w, Details(err))
+	} else {
+		fmt.Fprintln(w, err.Error())
+	}
+	exit(ExitCode(err))
+}
+
+// Must wraps err like New and hands it to Handle, for one-liners like
+// `we.Must(mustDoThis())` where there is nothing more useful to do with a
+// failure than to report it and exit. It calls new_newf directly instead
+// of going through New, so the one extra frame Must itself adds doesn't
+// push caller attribution off the real call site and onto we.Must.
+func Must(err error) {
+	Handle(new_newf(false, 4, err)) // skip 4: Must(), new_newf(), caller() and runtime.Callers()
+}
+
+// Wrap prepends message to e, always nesting a new wrapped_error around e
+// instead of mutating it (unlike New/Newf/Prependf). Use Wrap/Wrapf when
+// migrating code written against pkg/errors.Wrap, fmt.Errorf("...: %w", e)
+// or friendsofgo/errors.Wrap: every call adds one more link that
+// errors.Unwrap/Is/As can walk back through, all the way down to e.
+func Wrap(e error, message string) error {
+	return wrapf(e, "%s", []interface{}{message})
+}
+
+// Wrapf is like Wrap but with fmt formatting: the resulting message is
+// fmt.Sprintf(format, args...) followed by ": " and e.Error(). There is no
+// special %w handling -- e is always what Unwrap returns, and a %w verb
+// would need e spliced into args invisibly to the caller, which go vet's
+// printf check can't see, so every real call site would trip a bogus
+// "too few arguments" vet error. If you need actual %w semantics, build
+// the message with fmt.Errorf yourself and pass the result's cause to Wrap.
+func Wrapf(e error, format string, args ...interface{}) error {
+	return wrapf(e, format, args)
+}
+
+// wrapf is the shared implementation behind Wrap and Wrapf, called directly
+// by both so a single captureStack skip count lands on the caller's frame
+// for either entry point -- Wrap calling Wrapf would otherwise add a frame
+// and put we.Wrap itself at the top of the stack trace.
+func wrapf(e error, format string, args []interface{}) error {
+	if e == nil {
+		return nil
+	}
+	return &wrapped_error{
+		msg:   fmt.Sprintf("%s: %s", fmt.Sprintf(format, args...), e.Error()),
+		cause: e,
+		code:  DefaultExitCode,
+		stack: captureStack(4), // skip 4: Wrap[f](), wrapf(), captureStack() and runtime.Callers()
+	}
+}
+
+// raised is the sentinel panic value Raise/Catch use, so Catch can tell a
+// we.Raise() panic apart from any other panic and let the latter through.
+type raised struct {
+	err error
+}
+
+// Raise panics with err wrapped in the we.Raise/we.Catch sentinel. Pair
+// with `defer we.Catch(&err)` at the top of a function to get
+// Python/Nexedi-style exception flow without abandoning idiomatic error
+// returns at the function's own boundary.
+func Raise(err error) {
+	if err == nil {
+		return
+	}
+	panic(&raised{err: err})
+}
+
+// Catch is meant to be used as `defer we.Catch(&err)`. It recovers only
+// panics raised by we.Raise (re-panicking anything else untouched) and
+// assigns *errp the underlying error, wrapped with the deferring function's
+// frame the same way New does.
+func Catch(errp *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	raised, ok := r.(*raised)
+	if !ok {
+		panic(r)
+	}
+
+	// skip 5: Catch(), caller(), runtime.gopanic() (we're unwinding a
+	// panic, not a plain call) and Raise(), landing on whoever called
+	// Raise() -- that depth is fixed regardless of how many frames
+	// separate the raise site from the function deferring Catch.
+	funcname := caller(5)
+	if !MainPrefix && strings.HasPrefix(funcname, "main.") {
+		funcname = funcname[5:]
+	}
+	msg := fmt.Sprintf("%s(): %s", funcname, raised.err.Error())
+
+	if e, ok := raised.err.(*wrapped_error); ok {
+		e.msg = msg
+		*errp = e
+		return
+	}
+	res := new(wrapped_error)
+	res.msg = msg
+	res.cause = raised.err
+	res.code = DefaultExitCode
+	res.stack = captureStack(5) // skip 5: same landing point as caller(5) above
+	*errp = res
+}
+
+// Context is a defer-friendly wrapper prepending formatted context onto
+// whatever error *errp holds by the time the deferring function returns,
+// e.g. `defer we.Context(&err, "processing %s", name)`. A nil *errp is a
+// no-op, same as Prependf would be a no-op on a nil error.
+func Context(errp *error, format string, args ...interface{}) {
+	if errp == nil || *errp == nil {
+		return
+	}
+	*errp = Prependf(*errp, format, args...)
+}
+
+// Multi aggregates the errors of several independent failures into one,
+// for concurrent worker patterns where each goroutine returns its own
+// we.New(err, ...) and the caller wants to preserve every failure along
+// with a coherent exit status.
+type Multi struct {
+	errs []error
+}
+
+// Error joins the message of every child error, one per line, in the style
+// of urfave/cli's MultiError.
+func (self *Multi) Error() string {
+	msgs := make([]string, len(self.errs))
+	for i, e := range self.errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the child errors, so errors.Is/errors.As (Go 1.20+) can
+// traverse into each of them.
+func (self *Multi) Unwrap() []error {
+	return self.errs
+}
+
+// ExitCode returns the maximum non-default exit code among the children,
+// or DefaultExitCode if none of them set one.
+func (self *Multi) ExitCode() int {
+	max := DefaultExitCode
+	found := false
+	for _, e := range self.errs {
+		if code := ExitCode(e); code != DefaultExitCode && (!found || code > max) {
+			max = code
+			found = true
+		}
+	}
+	return max
+}
+
+// Append adds errs to err, flattening any of them that are already a
+// *Multi and skipping nils, and returns the result: nil if everything was
+// nil, the lone survivor if there was only one, or a *Multi otherwise.
+func Append(err error, errs ...error) error {
+	return Combine(append([]error{err}, errs...)...)
+}
+
+// Combine is like Append with no base error, for building a Multi up from
+// scratch, e.g. out of several goroutines' results.
+func Combine(errs ...error) error {
+	var flat []error
+	for _, e := range errs {
+		if e == nil {
+			continue
+		}
+		if m, ok := e.(*Multi); ok {
+			flat = append(flat, m.errs...)
+			continue
+		}
+		flat = append(flat, e)
+	}
+	switch len(flat) {
+	case 0:
+		return nil
+	case 1:
+		return flat[0]
+	default:
+		return &Multi{errs: flat}
+	}
+}
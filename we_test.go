@@ -0,0 +1,154 @@
+package we
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWrapfAppendsCause(t *testing.T) {
+	leaf := errors.New("disk full")
+	err := Wrapf(leaf, "ctx %d", 42)
+	if got, want := err.Error(), "ctx 42: disk full"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if errors.Unwrap(err) != leaf {
+		t.Errorf("Unwrap() did not return leaf")
+	}
+}
+
+func TestExitCodeThroughWrap(t *testing.T) {
+	leaf := errors.New("disk full")
+	err := Wrap(WithExitCode(42, leaf), "ctx")
+	if got := ExitCode(err); got != 42 {
+		t.Errorf("ExitCode() = %d, want 42", got)
+	}
+}
+
+func TestExitCodeDefault(t *testing.T) {
+	if got := ExitCode(errors.New("plain")); got != DefaultExitCode {
+		t.Errorf("ExitCode() = %d, want DefaultExitCode", got)
+	}
+}
+
+func TestValueValuesUserMessageThroughMulti(t *testing.T) {
+	e1 := WithUserMessage(WithValue(New(errors.New("e1")), "k", "v"), "nice message")
+	e2 := errors.New("e2")
+	m := Combine(e1, e2)
+
+	if got := Value(m, "k"); got != "v" {
+		t.Errorf("Value() = %v, want %q", got, "v")
+	}
+	if got := Values(m)["k"]; got != "v" {
+		t.Errorf("Values()[\"k\"] = %v, want %q", got, "v")
+	}
+	if got := UserMessage(m); got != "nice message" {
+		t.Errorf("UserMessage() = %q, want %q", got, "nice message")
+	}
+}
+
+func TestWrapStackFrameLandsOnCaller(t *testing.T) {
+	err := Wrap(errors.New("disk full"), "ctx")
+	frames := err.(*wrapped_error).StackTrace()
+	if len(frames) == 0 {
+		t.Fatalf("StackTrace() is empty")
+	}
+	if got := frames[0].Function; strings.Contains(got, "we.Wrap") || strings.Contains(got, "we.wrapf") {
+		t.Errorf("top stack frame = %q, want the caller's frame, not Wrap/wrapf itself", got)
+	}
+}
+
+func TestHandleWithReportsAndExits(t *testing.T) {
+	var buf bytes.Buffer
+	var gotCode int
+	exit := func(code int) { gotCode = code }
+
+	HandleWith(&buf, exit, WithExitCode(7, errors.New("disk full")))
+
+	if gotCode != 7 {
+		t.Errorf("exit code = %d, want 7", gotCode)
+	}
+	if !strings.Contains(buf.String(), "disk full") {
+		t.Errorf("output = %q, want it to contain %q", buf.String(), "disk full")
+	}
+}
+
+func TestHandleWithNilIsNoop(t *testing.T) {
+	var buf bytes.Buffer
+	called := false
+	exit := func(int) { called = true }
+
+	HandleWith(&buf, exit, nil)
+
+	if called {
+		t.Errorf("exit func was called for a nil error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("output = %q, want empty", buf.String())
+	}
+}
+
+// mustLikeCaller mirrors Must's own body (minus the Handle/os.Exit tail,
+// which we can't safely exercise from a test) to verify that bypassing New
+// from one caller's worth of extra depth still attributes to whoever called
+// this function, not to mustLikeCaller itself.
+func mustLikeCaller(err error) error {
+	return new_newf(false, 4, err)
+}
+
+func TestMustAttributesToCaller(t *testing.T) {
+	err := mustLikeCaller(errors.New("disk full"))
+	got := err.Error()
+	if !strings.Contains(got, "TestMustAttributesToCaller") {
+		t.Errorf("Error() = %q, want it to mention the real caller TestMustAttributesToCaller", got)
+	}
+	if strings.Contains(got, "mustLikeCaller") {
+		t.Errorf("Error() = %q, incorrectly attributed to the Must-like wrapper frame", got)
+	}
+}
+
+func raiseFromLevel3() {
+	Raise(errors.New("disk full"))
+}
+
+func raiseFromLevel2() {
+	raiseFromLevel3()
+}
+
+// raiseFromLevel1 is the function that defers Catch -- a 3-level call chain
+// (this -> level2 -> level3 -> Raise) so a fixed skip depth can be told
+// apart from one that only happens to work for a direct 2-level call.
+func raiseFromLevel1() (err error) {
+	defer Catch(&err)
+	raiseFromLevel2()
+	return nil
+}
+
+func TestRaiseCatchMultiLevel(t *testing.T) {
+	err := raiseFromLevel1()
+	if err == nil {
+		t.Fatalf("Catch did not recover the raised error")
+	}
+	// Catch attributes to whoever directly called Raise (raiseFromLevel3),
+	// not to the function deferring Catch (raiseFromLevel1) -- a 2-level
+	// chain couldn't distinguish that from an accidentally-correct skip.
+	got := err.Error()
+	if !strings.Contains(got, "raiseFromLevel3") {
+		t.Errorf("Error() = %q, want it to attribute to raiseFromLevel3 (the direct caller of Raise)", got)
+	}
+	if strings.Contains(got, "raiseFromLevel1") || strings.Contains(got, "raiseFromLevel2") {
+		t.Errorf("Error() = %q, incorrectly attributed to an intermediate or deferring frame", got)
+	}
+}
+
+func TestContextPrependsOnReturn(t *testing.T) {
+	fn := func() (err error) {
+		defer Context(&err, "processing %s", "widget")
+		return errors.New("disk full")
+	}
+	err := fn()
+	if got, want := err.Error(), "processing widget: disk full"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}